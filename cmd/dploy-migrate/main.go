@@ -0,0 +1,28 @@
+// Command dploy-migrate applies internal/database's migrations against a deploy history
+// database, creating it if it doesn't exist yet. It's a thin wrapper around
+// database.Open, which applies migrations as part of opening the connection.
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/Xe/dploy/internal/database"
+)
+
+var (
+	driver = flag.String("driver", "sqlite3", "database driver to use (postgres, sqlite3)")
+	dsn    = flag.String("dsn", "dploy.db", "data source name / connection string")
+)
+
+func main() {
+	flag.Parse()
+
+	store, err := database.Open(*driver, *dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	log.Printf("Migrations applied to %s database at %s", *driver, *dsn)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Xe/dploy/lib/backplane"
+	"github.com/Xe/dploy/lib/backplane/strategy"
+	"github.com/Xe/dploy/lib/compose"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+)
+
+// composeService tracks one compose-defined service through a coordinated multi-service
+// deploy: what it is, the Swarm service created for it, and the old/new route IDs its
+// traffic is being shaped between.
+type composeService struct {
+	svc       compose.Service
+	serviceID string
+	oldRoute  string
+	newRoute  string
+}
+
+// composeRollbackState tracks what runComposeDeploy has created so far, the same way
+// rollbackState does for a single-service deploy, so a ^C or a mid-batch failure can unwind
+// exactly the services and routes it actually touched.
+var composeRollbackState struct {
+	deployed []*composeService
+}
+
+// composeRollback tears down every Swarm service runComposeDeploy has created so far and
+// reshapes any routes it had started ramping back onto their old route at 100%. It is safe
+// to call with a partially populated composeRollbackState, e.g. after a failure partway
+// through the create loop or an in-progress ramp.
+func composeRollback(cli *client.Client, bp *backplane.Client) {
+	for _, d := range composeRollbackState.deployed {
+		if d.oldRoute != "" && d.newRoute != "" {
+			log.Printf("Rolling back %s: reshaping traffic back to %s", d.svc.Name, d.oldRoute)
+			if err := bp.Shape(context.Background(), d.svc.Endpoint, map[string]int{d.oldRoute: 100, d.newRoute: 0}); err != nil {
+				log.Println("compose rollback: failed to reshape traffic for " + d.svc.Name + ": " + err.Error())
+			}
+		}
+
+		if d.serviceID != "" {
+			log.Printf("Rolling back %s: removing service %s", d.svc.Name, d.serviceID)
+			if err := cli.ServiceRemove(context.Background(), d.serviceID); err != nil {
+				log.Println("compose rollback: failed to remove service " + d.svc.Name + ": " + err.Error())
+			}
+		}
+	}
+}
+
+// checkComposeHealth polls Backplane for the health of every deployed service's new route
+// and returns an error describing the problem if any one of them exceeds errorThreshold,
+// mirroring checkHealth for the single-service deploy path.
+func checkComposeHealth(ctx context.Context, bp *backplane.Client) error {
+	for _, d := range composeRollbackState.deployed {
+		total, unhealthy, err := bp.RouteHealth(ctx, d.svc.Endpoint, d.newRoute)
+		if err != nil {
+			return err
+		}
+
+		if total == 0 {
+			continue
+		}
+
+		if float64(unhealthy)/float64(total) > *errorThreshold {
+			return fmt.Errorf("%s: %d/%d backends on new route unhealthy", d.svc.Name, unhealthy, total)
+		}
+	}
+
+	return nil
+}
+
+// runComposeDeploy deploys every service in the compose/stack file at path and then shapes
+// all of their routes over to the new versions using the --strategy strategy, one strategy
+// run per service, each checking the health of every service deployed so far rather than
+// just its own. ctx is honored throughout: canceling it (e.g. from the ^C handler) aborts
+// mid-ramp, and any failure along the way unwinds whatever this call has created via
+// composeRollback.
+func runComposeDeploy(ctx context.Context, cli *client.Client, bp *backplane.Client, path string) error {
+	services, err := compose.Load(path)
+	if err != nil {
+		return err
+	}
+
+	composeRollbackState.deployed = make([]*composeService, 0, len(services))
+
+	for _, svc := range services {
+		log.Printf("Deploying %s (%s:%s) on %s", svc.Name, svc.Image, svc.Version, svc.Endpoint)
+
+		serviceID, err := createComposeService(ctx, cli, bp, svc)
+		if err != nil {
+			rollbackOnce.Do(func() { composeRollback(cli, bp) })
+			return fmt.Errorf("%s: %w", svc.Name, err)
+		}
+		log.Println("Created service " + serviceID)
+
+		d := &composeService{svc: svc, serviceID: serviceID}
+		composeRollbackState.deployed = append(composeRollbackState.deployed, d)
+
+		newRouteID, err := createComposeRoute(ctx, bp, svc)
+		if err != nil {
+			rollbackOnce.Do(func() { composeRollback(cli, bp) })
+			return fmt.Errorf("%s: %w", svc.Name, err)
+		}
+		d.newRoute = newRouteID
+	}
+
+	deployed := composeRollbackState.deployed
+
+	for _, d := range deployed {
+		log.Printf("Waiting for %s to be primed...", d.svc.Name)
+		if err := waitForComposeContainers(ctx, bp, d.svc, d.newRoute); err != nil {
+			rollbackOnce.Do(func() { composeRollback(cli, bp) })
+			return fmt.Errorf("%s: %w", d.svc.Name, err)
+		}
+	}
+
+	q, err := bp.Query(ctx)
+	if err != nil {
+		rollbackOnce.Do(func() { composeRollback(cli, bp) })
+		return err
+	}
+
+	for _, d := range deployed {
+		for _, e := range q.Endpoints {
+			if e.Pattern != d.svc.Endpoint {
+				continue
+			}
+
+			for _, route := range e.Routes {
+				if route.Weight == 100 {
+					d.oldRoute = route.ID
+				}
+			}
+		}
+	}
+
+	strat, ok := strategy.Get(*strategyName, *shapePause)
+	if !ok {
+		rollbackOnce.Do(func() { composeRollback(cli, bp) })
+		return fmt.Errorf("unknown strategy %q", *strategyName)
+	}
+
+	log.Printf("Performing 0 downtime shape using the %s strategy across %d services", strat.Name(), len(deployed))
+
+	errs := make(chan error, len(deployed))
+
+	var wg sync.WaitGroup
+	for _, d := range deployed {
+		wg.Add(1)
+		go func(d *composeService) {
+			defer wg.Done()
+
+			health := func() error { return checkComposeHealth(ctx, bp) }
+			if err := strat.Run(ctx, bp, d.svc.Endpoint, d.oldRoute, d.newRoute, health, nil); err != nil {
+				errs <- fmt.Errorf("%s: %w", d.svc.Name, err)
+			}
+		}(d)
+	}
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		rollbackOnce.Do(func() { composeRollback(cli, bp) })
+		return err
+	}
+
+	log.Println("Coordinated compose deploy complete")
+	return nil
+}
+
+func createComposeService(ctx context.Context, c *client.Client, bp *backplane.Client, svc compose.Service) (string, error) {
+	token, err := bp.GenToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	spec := swarm.ServiceSpec{
+		Annotations: swarm.Annotations{
+			Name: svc.Name + "-" + svc.Version,
+			Labels: map[string]string{
+				"Xe.dploy/service":  svc.Name,
+				"Xe.dploy/endpoint": svc.Endpoint,
+				"Xe.dploy/version":  svc.Version,
+			},
+		},
+
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: swarm.ContainerSpec{
+				Image: svc.Image,
+				Env: []string{
+					"BACKPLANE_TOKEN=" + token,
+					"BACKPLANE_LABELS=" + fmt.Sprintf(
+						"service:%s version:%s endpoint:%s",
+						svc.Name, svc.Version, svc.Endpoint,
+					),
+				},
+			},
+		},
+
+		Mode: swarm.ServiceMode{
+			Replicated: &swarm.ReplicatedService{
+				Replicas: &svc.ReplicaCount,
+			},
+		},
+	}
+
+	resp, err := c.ServiceCreate(ctx, spec, types.ServiceCreateOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	return resp.ID, nil
+}
+
+func createComposeRoute(ctx context.Context, bp *backplane.Client, svc compose.Service) (string, error) {
+	route, err := bp.Route(ctx, svc.Endpoint, map[string]string{
+		"service":  svc.Name,
+		"endpoint": svc.Endpoint,
+		"version":  svc.Version,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("Created %s for %s", route.ID, svc.Endpoint)
+	return route.ID, nil
+}
+
+func waitForComposeContainers(ctx context.Context, bp *backplane.Client, svc compose.Service, routeID string) error {
+	t := time.Tick(time.Second)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t:
+		}
+
+		q, err := bp.Query(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range q.Endpoints {
+			if e.Pattern != svc.Endpoint {
+				continue
+			}
+
+			for _, route := range e.Routes {
+				if route.ID == routeID && len(route.Backends) == int(svc.ReplicaCount) {
+					return nil
+				}
+			}
+		}
+	}
+}
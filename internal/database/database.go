@@ -0,0 +1,75 @@
+// Package database records dploy's deploy history: what was deployed, the routes it shaped
+// traffic between, the timing of each shaping step, and how the deploy ended. Postgres and
+// SQLite implementations share the Store interface so either can back the `dploy history`,
+// `dploy rollback`, and `dploy status` subcommands.
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// Deploy outcomes. A Deploy with an empty Outcome is still in progress.
+const (
+	OutcomeSuccess  = "success"
+	OutcomeRollback = "rollback"
+	OutcomeAborted  = "aborted"
+)
+
+// Deploy is one recorded dploy run.
+type Deploy struct {
+	ID         int64
+	Service    string
+	Image      string
+	Version    string
+	Endpoint   string
+	OldRouteID string
+	NewRouteID string
+	StartedAt  time.Time
+	FinishedAt *time.Time
+	Outcome    string
+}
+
+// ShapeStep is one traffic-shaping step taken during a Deploy, with its timing.
+type ShapeStep struct {
+	DeployID   int64
+	Step       int
+	OldWeight  int
+	NewWeight  int
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Store records and retrieves Deploys and their ShapeSteps.
+type Store interface {
+	// CreateDeploy records the start of a new deploy and returns its ID.
+	CreateDeploy(d Deploy) (int64, error)
+
+	// RecordStep appends a completed shaping step to a deploy's history.
+	RecordStep(s ShapeStep) error
+
+	// FinishDeploy records a deploy's outcome and finish time.
+	FinishDeploy(id int64, outcome string, finishedAt time.Time) error
+
+	// Deploys returns every recorded deploy, most recent first.
+	Deploys() ([]Deploy, error)
+
+	// Deploy returns a single deploy by ID, along with its recorded shape steps in order.
+	Deploy(id int64) (Deploy, []ShapeStep, error)
+
+	// Close releases the underlying database connection.
+	Close() error
+}
+
+// Open opens a Store backed by driver ("postgres" or "sqlite3") at dsn, applying any
+// outstanding migrations before returning.
+func Open(driver, dsn string) (Store, error) {
+	switch driver {
+	case "postgres":
+		return openPostgres(dsn)
+	case "sqlite3":
+		return openSQLite(dsn)
+	default:
+		return nil, fmt.Errorf("database: unsupported driver %q", driver)
+	}
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) Store {
+	t.Helper()
+
+	store, err := Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+// TestCreateDeployRoundTrip checks that a created deploy can be read back with its recorded
+// steps and finished outcome, across CreateDeploy, RecordStep, FinishDeploy, Deploys and
+// Deploy.
+func TestCreateDeployRoundTrip(t *testing.T) {
+	store := openTestStore(t)
+
+	started := time.Now().Truncate(time.Second)
+	id, err := store.CreateDeploy(Deploy{
+		Service:    "web",
+		Image:      "web",
+		Version:    "v1",
+		Endpoint:   "web.example.com",
+		OldRouteID: "old",
+		NewRouteID: "new",
+		StartedAt:  started,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stepStart := started.Add(time.Second)
+	stepEnd := stepStart.Add(time.Second)
+	if err := store.RecordStep(ShapeStep{
+		DeployID:   id,
+		Step:       1,
+		OldWeight:  75,
+		NewWeight:  25,
+		StartedAt:  stepStart,
+		FinishedAt: stepEnd,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	finished := stepEnd.Add(time.Second)
+	if err := store.FinishDeploy(id, OutcomeSuccess, finished); err != nil {
+		t.Fatal(err)
+	}
+
+	d, steps, err := store.Deploy(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Service != "web" || d.Outcome != OutcomeSuccess {
+		t.Fatalf("unexpected deploy: %+v", d)
+	}
+
+	if d.FinishedAt == nil || !d.FinishedAt.Equal(finished) {
+		t.Fatalf("expected FinishedAt %v, got %v", finished, d.FinishedAt)
+	}
+
+	if len(steps) != 1 || steps[0].OldWeight != 75 || steps[0].NewWeight != 25 {
+		t.Fatalf("unexpected steps: %+v", steps)
+	}
+
+	all, err := store.Deploys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != 1 || all[0].ID != id {
+		t.Fatalf("expected Deploys to return the one deploy created, got %+v", all)
+	}
+}
+
+// TestOpenTwiceDoesNotRerunMigrations checks that a second Open against the same database
+// succeeds instead of failing on CREATE TABLE statements for tables that already exist,
+// since runMigrations should skip versions already recorded in schema_migrations.
+func TestOpenTwiceDoesNotRerunMigrations(t *testing.T) {
+	dsn := t.TempDir() + "/dploy.db"
+
+	first, err := Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Close()
+
+	second, err := Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("second Open against an already-migrated database failed: %v", err)
+	}
+	defer second.Close()
+
+	if _, err := second.CreateDeploy(Deploy{Service: "web", StartedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration is one versioned schema change, with separate DDL for each supported driver
+// since column types (SERIAL vs AUTOINCREMENT, TIMESTAMPTZ vs DATETIME) aren't portable.
+// Once a migration's version has been recorded in schema_migrations, it is never run again.
+type migration struct {
+	version  int
+	postgres []string
+	sqlite   []string
+}
+
+// migrations is every schema migration, in the order they must be applied. Append new
+// migrations to the end; never edit or remove one that has already shipped, since a deploy
+// history database out in the wild may already have recorded it as applied.
+var migrations = []migration{
+	{
+		version: 1,
+		postgres: []string{
+			`CREATE TABLE deploys (
+				id SERIAL PRIMARY KEY,
+				service TEXT NOT NULL,
+				image TEXT NOT NULL,
+				version TEXT NOT NULL,
+				endpoint TEXT NOT NULL,
+				old_route_id TEXT NOT NULL,
+				new_route_id TEXT NOT NULL,
+				started_at TIMESTAMPTZ NOT NULL,
+				finished_at TIMESTAMPTZ,
+				outcome TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE TABLE shape_steps (
+				deploy_id INTEGER NOT NULL REFERENCES deploys(id),
+				step INTEGER NOT NULL,
+				old_weight INTEGER NOT NULL,
+				new_weight INTEGER NOT NULL,
+				started_at TIMESTAMPTZ NOT NULL,
+				finished_at TIMESTAMPTZ NOT NULL
+			)`,
+		},
+		sqlite: []string{
+			`CREATE TABLE deploys (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				service TEXT NOT NULL,
+				image TEXT NOT NULL,
+				version TEXT NOT NULL,
+				endpoint TEXT NOT NULL,
+				old_route_id TEXT NOT NULL,
+				new_route_id TEXT NOT NULL,
+				started_at DATETIME NOT NULL,
+				finished_at DATETIME,
+				outcome TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE TABLE shape_steps (
+				deploy_id INTEGER NOT NULL REFERENCES deploys(id),
+				step INTEGER NOT NULL,
+				old_weight INTEGER NOT NULL,
+				new_weight INTEGER NOT NULL,
+				started_at DATETIME NOT NULL,
+				finished_at DATETIME NOT NULL
+			)`,
+		},
+	},
+}
+
+// runMigrations brings db up to the latest schema version for driver ("postgres" or
+// "sqlite3"), recording each migration's version in a schema_migrations table as it's applied
+// so that re-opening the same database doesn't re-run DDL that already succeeded.
+func runMigrations(db *sql.DB, driver string) error {
+	tracking := `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at ` + timestampType(driver) + ` NOT NULL)`
+	if _, err := db.Exec(tracking); err != nil {
+		return fmt.Errorf("database: create schema_migrations: %w", err)
+	}
+
+	applied := map[int]bool{}
+	rows, err := db.Query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return fmt.Errorf("database: read schema_migrations: %w", err)
+	}
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return fmt.Errorf("database: read schema_migrations: %w", err)
+		}
+		applied[v] = true
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("database: read schema_migrations: %w", err)
+	}
+	rows.Close()
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+
+		stmts := m.postgres
+		if driver == "sqlite3" {
+			stmts = m.sqlite
+		}
+
+		for _, stmt := range stmts {
+			if _, err := db.Exec(stmt); err != nil {
+				return fmt.Errorf("database: migration %d: %w", m.version, err)
+			}
+		}
+
+		_, err := db.Exec(rebind(driver, `INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`), m.version, time.Now())
+		if err != nil {
+			return fmt.Errorf("database: migration %d: record applied: %w", m.version, err)
+		}
+	}
+
+	return nil
+}
+
+// timestampType returns the column type runMigrations uses for schema_migrations.applied_at,
+// matching the TIMESTAMPTZ/DATETIME split the versioned migrations themselves use.
+func timestampType(driver string) string {
+	if driver == "sqlite3" {
+		return "DATETIME"
+	}
+
+	return "TIMESTAMPTZ"
+}
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"database/sql"
+
+	// Registers the "postgres" database/sql driver.
+	_ "github.com/lib/pq"
+)
+
+func openPostgres(dsn string) (Store, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := runMigrations(db, "postgres"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqlStore{db: db, driver: "postgres"}, nil
+}
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"database/sql"
+
+	// Registers the "sqlite3" database/sql driver.
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openSQLite(dsn string) (Store, error) {
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := runMigrations(db, "sqlite3"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqlStore{db: db, driver: "sqlite3"}, nil
+}
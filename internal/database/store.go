@@ -0,0 +1,131 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sqlStore is a Store backed by database/sql, implemented once against both Postgres and
+// SQLite: their queries only differ in placeholder style ($N vs ?) and how an inserted row's
+// ID is recovered, both handled below. Their schemas differ in column types, which
+// migrations.go handles.
+type sqlStore struct {
+	db     *sql.DB
+	driver string
+}
+
+// rebind rewrites query's ?-style placeholders into $1, $2, ... when driver is "postgres".
+// sqlite3 takes ? natively, so it's returned unchanged.
+func rebind(driver, query string) string {
+	if driver != "postgres" {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func (s *sqlStore) CreateDeploy(d Deploy) (int64, error) {
+	query := `INSERT INTO deploys (service, image, version, endpoint, old_route_id, new_route_id, started_at, outcome)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, '')`
+
+	if s.driver == "postgres" {
+		var id int64
+		err := s.db.QueryRow(
+			rebind(s.driver, query+" RETURNING id"),
+			d.Service, d.Image, d.Version, d.Endpoint, d.OldRouteID, d.NewRouteID, d.StartedAt,
+		).Scan(&id)
+
+		return id, err
+	}
+
+	res, err := s.db.Exec(query, d.Service, d.Image, d.Version, d.Endpoint, d.OldRouteID, d.NewRouteID, d.StartedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
+
+func (s *sqlStore) RecordStep(step ShapeStep) error {
+	_, err := s.db.Exec(
+		rebind(s.driver, `INSERT INTO shape_steps (deploy_id, step, old_weight, new_weight, started_at, finished_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`),
+		step.DeployID, step.Step, step.OldWeight, step.NewWeight, step.StartedAt, step.FinishedAt,
+	)
+
+	return err
+}
+
+func (s *sqlStore) FinishDeploy(id int64, outcome string, finishedAt time.Time) error {
+	_, err := s.db.Exec(rebind(s.driver, `UPDATE deploys SET outcome = ?, finished_at = ? WHERE id = ?`), outcome, finishedAt, id)
+	return err
+}
+
+func (s *sqlStore) Deploys() ([]Deploy, error) {
+	rows, err := s.db.Query(`SELECT id, service, image, version, endpoint, old_route_id, new_route_id, started_at, finished_at, outcome FROM deploys ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Deploy
+	for rows.Next() {
+		var d Deploy
+		if err := rows.Scan(&d.ID, &d.Service, &d.Image, &d.Version, &d.Endpoint, &d.OldRouteID, &d.NewRouteID, &d.StartedAt, &d.FinishedAt, &d.Outcome); err != nil {
+			return nil, err
+		}
+
+		out = append(out, d)
+	}
+
+	return out, rows.Err()
+}
+
+func (s *sqlStore) Deploy(id int64) (Deploy, []ShapeStep, error) {
+	var d Deploy
+	err := s.db.QueryRow(
+		rebind(s.driver, `SELECT id, service, image, version, endpoint, old_route_id, new_route_id, started_at, finished_at, outcome FROM deploys WHERE id = ?`),
+		id,
+	).Scan(&d.ID, &d.Service, &d.Image, &d.Version, &d.Endpoint, &d.OldRouteID, &d.NewRouteID, &d.StartedAt, &d.FinishedAt, &d.Outcome)
+	if err != nil {
+		return Deploy{}, nil, err
+	}
+
+	rows, err := s.db.Query(
+		rebind(s.driver, `SELECT deploy_id, step, old_weight, new_weight, started_at, finished_at FROM shape_steps WHERE deploy_id = ? ORDER BY step`),
+		id,
+	)
+	if err != nil {
+		return d, nil, err
+	}
+	defer rows.Close()
+
+	var steps []ShapeStep
+	for rows.Next() {
+		var st ShapeStep
+		if err := rows.Scan(&st.DeployID, &st.Step, &st.OldWeight, &st.NewWeight, &st.StartedAt, &st.FinishedAt); err != nil {
+			return d, nil, err
+		}
+
+		steps = append(steps, st)
+	}
+
+	return d, steps, rows.Err()
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
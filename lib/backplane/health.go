@@ -0,0 +1,55 @@
+package backplane
+
+import "context"
+
+// RouteHealth inspects the Backends currently attached to routeID on endpoint and reports
+// how many of them look unhealthy. A Backend counts as unhealthy if its State is anything
+// other than "healthy", or if it is reporting zero RequestsPerSecond despite being attached
+// to a Route that is actively receiving traffic (Weight > 0). total is the number of
+// Backends attached to the route, which may be zero if the route has no Backends yet.
+func (c *Client) RouteHealth(ctx context.Context, endpoint, routeID string) (total, unhealthy int, err error) {
+	q, err := c.Query(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, e := range q.Endpoints {
+		if e.Pattern != endpoint {
+			continue
+		}
+
+		for _, route := range e.Routes {
+			if route.ID != routeID {
+				continue
+			}
+
+			backends := map[string]Backend{}
+			for _, b := range q.Backends {
+				backends[b.ID] = b
+			}
+
+			for _, id := range route.Backends {
+				total++
+
+				b, ok := backends[id]
+				if !ok {
+					unhealthy++
+					continue
+				}
+
+				if b.State != "healthy" {
+					unhealthy++
+					continue
+				}
+
+				if route.Weight > 0 && b.RequestsPerSecond == 0 {
+					unhealthy++
+				}
+			}
+
+			return total, unhealthy, nil
+		}
+	}
+
+	return 0, 0, nil
+}
@@ -2,8 +2,10 @@ package backplane
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -15,14 +17,66 @@ const (
 	backplaneHost = "www.backplane.io"
 )
 
+// RetryPolicy controls how APIContext retries a request after a 5xx response or network
+// error. MaxAttempts counts every attempt, the first one included. The first retry waits
+// BaseDelay, and each later retry waits twice as long as the one before it.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+}
+
+// defaultRetryPolicy is used by New unless overridden with WithRetry.
+var defaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: 250 * time.Millisecond}
+
 // Client is the API client that performs actions against the Backplane API server.
 type Client struct {
-	token string
+	token      string
+	httpClient *http.Client
+	baseURL    string
+	retry      RetryPolicy
+}
+
+// ClientOption configures optional Client behavior; see WithHTTPClient, WithTimeout,
+// WithRetry, and WithBaseURL.
+type ClientOption func(*Client)
+
+// WithHTTPClient overrides the http.Client used for requests. Useful for tests or for
+// sharing a client configured with custom transport settings.
+func WithHTTPClient(h *http.Client) ClientOption {
+	return func(c *Client) { c.httpClient = h }
 }
 
-// New creates a new API client with the given token
-func New(token string) (*Client, error) {
-	return &Client{token}, nil
+// WithTimeout sets the per-request timeout on the Client's http.Client.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(c *Client) { c.httpClient.Timeout = d }
+}
+
+// WithRetry overrides the retry policy used by APIContext (and API, which calls it).
+func WithRetry(policy RetryPolicy) ClientOption {
+	return func(c *Client) { c.retry = policy }
+}
+
+// WithBaseURL overrides the Backplane API base URL, mainly for testing against a local
+// server.
+func WithBaseURL(url string) ClientOption {
+	return func(c *Client) { c.baseURL = url }
+}
+
+// New creates a new API client with the given token, a 30 second request timeout, and up to
+// 3 attempts (2 retries) on 5xx responses or network errors, unless overridden with opts.
+func New(token string, opts ...ClientOption) (*Client, error) {
+	c := &Client{
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		baseURL:    backplaneURL,
+		retry:      defaultRetryPolicy,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
 }
 
 // setBasicAuth adds needed authentication information to a HTTP request.
@@ -32,35 +86,85 @@ func (c *Client) setBasicAuth(req *http.Request) error {
 	return nil
 }
 
-// API is a generic json-encoding like function that allows access to any backplane.io API call.
+// APIError is returned by APIContext when Backplane responds with a non-200 status. It
+// carries the status code and response body so callers can distinguish, e.g., a 4xx client
+// error from a 5xx that's worth retrying.
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("backplane: request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// API is a generic json-encoding like function that allows access to any backplane.io API
+// call. It's equivalent to APIContext with context.Background().
 //
 // See the implementation of Client.Query and Client.Shape for usage information.
 func (c *Client) API(method, path string, parameters map[string]string, postData interface{}, out interface{}) error {
+	return c.APIContext(context.Background(), method, path, parameters, postData, out)
+}
+
+// APIContext is API, but cancelable via ctx and retried with exponential backoff on 5xx
+// responses or network errors, up to the Client's RetryPolicy.
+func (c *Client) APIContext(ctx context.Context, method, path string, parameters map[string]string, postData interface{}, out interface{}) error {
 	v := url.Values{}
+	for key, value := range parameters {
+		v.Add(key, value)
+	}
+
+	var lastErr error
+
+	for attempt := 0; attempt < c.retry.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			delay := c.retry.BaseDelay * time.Duration(int64(1)<<uint(attempt-1))
+
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		err := c.do(ctx, method, path, v, postData, out)
+		if err == nil {
+			return nil
+		}
+
+		lastErr = err
 
-	req, err := http.NewRequest(method, backplaneURL+path, nil)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode < 500 {
+			return err
+		}
+	}
+
+	return lastErr
+}
+
+// do performs a single attempt of the request APIContext is retrying.
+func (c *Client) do(ctx context.Context, method, path string, v url.Values, postData interface{}, out interface{}) error {
+	req, err := http.NewRequest(method, c.baseURL+path, nil)
 	if err != nil {
 		return err
 	}
+	req = req.WithContext(ctx)
 
 	if method == "POST" || method == "PUT" {
-		out := &bytes.Buffer{}
-		err = json.NewEncoder(out).Encode(postData)
+		body := &bytes.Buffer{}
+		err = json.NewEncoder(body).Encode(postData)
 		if err != nil {
 			return err
 		}
 
-		req.Body = ioutil.NopCloser(out)
-	}
-
-	for key, value := range parameters {
-		v.Add(key, value)
+		req.Body = ioutil.NopCloser(body)
 	}
 
 	req.URL.RawQuery = v.Encode()
 	c.setBasicAuth(req)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -68,7 +172,7 @@ func (c *Client) API(method, path string, parameters map[string]string, postData
 
 	if resp.StatusCode != 200 {
 		rbody, _ := ioutil.ReadAll(resp.Body)
-		return errors.New("backplane: request failed " + string(rbody))
+		return &APIError{StatusCode: resp.StatusCode, Body: string(rbody)}
 	}
 
 	if out != nil {
@@ -134,9 +238,9 @@ type QueryResponse struct {
 }
 
 // Query fetches infornation about all Endpoints, Routes and Backends registered to your account.
-func (c *Client) Query() (*QueryResponse, error) {
+func (c *Client) Query(ctx context.Context) (*QueryResponse, error) {
 	result := &QueryResponse{}
-	err := c.API("GET", "/q", nil, nil, result)
+	err := c.APIContext(ctx, "GET", "/q", nil, nil, result)
 	if err != nil {
 		return nil, err
 	}
@@ -150,7 +254,7 @@ type routeRequest struct {
 }
 
 // Route creates a new Route on Backplane for the given pattern and label selector.
-func (c *Client) Route(pattern string, labels map[string]string) (*Route, error) {
+func (c *Client) Route(ctx context.Context, pattern string, labels map[string]string) (*Route, error) {
 	var flatSelectors string
 
 	for key, value := range labels {
@@ -165,7 +269,7 @@ func (c *Client) Route(pattern string, labels map[string]string) (*Route, error)
 	}
 	result := &Route{}
 
-	err := c.API("POST", "/route", nil, req, result)
+	err := c.APIContext(ctx, "POST", "/route", nil, req, result)
 	if err != nil {
 		return nil, err
 	}
@@ -179,7 +283,7 @@ type shapeRequest struct {
 }
 
 // Shape changes the weights on Routes of a given Endpoint.
-func (c *Client) Shape(endpoint string, weights map[string]int) error {
+func (c *Client) Shape(ctx context.Context, endpoint string, weights map[string]int) error {
 	routes := []Route{}
 
 	for route, weight := range weights {
@@ -194,7 +298,7 @@ func (c *Client) Shape(endpoint string, weights map[string]int) error {
 		Routes:  routes,
 	}
 
-	err := c.API("POST", "/shape", nil, req, nil)
+	err := c.APIContext(ctx, "POST", "/shape", nil, req, nil)
 	if err != nil {
 		return err
 	}
@@ -203,8 +307,8 @@ func (c *Client) Shape(endpoint string, weights map[string]int) error {
 }
 
 // GenToken creates a new Backplane API token for a future backplane Agent to user.
-func (c *Client) GenToken() (string, error) {
-	qOutput, err := c.Query()
+func (c *Client) GenToken(ctx context.Context) (string, error) {
+	qOutput, err := c.Query(ctx)
 	if err != nil {
 		return "", err
 	}
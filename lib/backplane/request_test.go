@@ -1,8 +1,14 @@
 package backplane
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestAuthenticate(t *testing.T) {
@@ -34,3 +40,97 @@ func TestQuery(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestAPIContextRetriesOn5xx checks that a request to a server that always 500s is attempted
+// RetryPolicy.MaxAttempts times in all, and that the final error is a *APIError carrying the
+// status code.
+func TestAPIContextRetriesOn5xx(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c, err := New("token", WithBaseURL(srv.URL), WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.APIContext(context.Background(), "GET", "/q", nil, nil, nil)
+	if err == nil {
+		t.Fatal("expected an error from a server that always 500s")
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected a 500 *APIError, got %v", err)
+	}
+
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Fatalf("expected 3 attempts, got %d", got)
+	}
+}
+
+// TestAPIContextNoRetryOn4xx checks that a 4xx response is returned immediately, without
+// burning through the retry budget, since retrying a client error won't fix it.
+func TestAPIContextNoRetryOn4xx(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	c, err := New("token", WithBaseURL(srv.URL), WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.APIContext(context.Background(), "GET", "/q", nil, nil, nil)
+	if err == nil {
+		t.Fatal("expected an error from a 400 response")
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a 400 *APIError, got %v", err)
+	}
+
+	if got := atomic.LoadInt32(&attempts); got != 1 {
+		t.Fatalf("expected exactly 1 attempt for a 4xx response, got %d", got)
+	}
+}
+
+// TestAPIContextCanceledMidBackoff checks that canceling ctx while APIContext is waiting out
+// a backoff delay aborts the retry loop immediately instead of waiting for the full delay.
+func TestAPIContextCanceledMidBackoff(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c, err := New("token", WithBaseURL(srv.URL), WithRetry(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	err = c.APIContext(ctx, "GET", "/q", nil, nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	if got := atomic.LoadInt32(&attempts); got != 1 {
+		t.Fatalf("expected exactly 1 attempt before the backoff was canceled, got %d", got)
+	}
+}
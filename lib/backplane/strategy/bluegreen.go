@@ -0,0 +1,36 @@
+package strategy
+
+import (
+	"context"
+	"time"
+
+	"github.com/Xe/dploy/lib/backplane"
+)
+
+// BlueGreen confirms the new route is healthy and then flips all traffic over to it in a
+// single step, rather than ramping gradually. Useful when a service can't tolerate serving
+// two versions side by side.
+type BlueGreen struct{}
+
+// Name implements Strategy.
+func (BlueGreen) Name() string { return "bluegreen" }
+
+// Run implements Strategy.
+func (BlueGreen) Run(ctx context.Context, bp *backplane.Client, endpoint, oldRouteID, newRouteID string, health HealthCheck, record StepRecorder) error {
+	if health != nil {
+		if err := health(); err != nil {
+			return err
+		}
+	}
+
+	started := time.Now()
+	if err := bp.Shape(ctx, endpoint, map[string]int{oldRouteID: 0, newRouteID: 100}); err != nil {
+		return err
+	}
+
+	if record != nil {
+		record(1, 1, 0, 100, started, time.Now())
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package strategy
+
+import (
+	"context"
+	"time"
+
+	"github.com/Xe/dploy/lib/backplane"
+)
+
+// ExponentialRamp sends the new route 1%, then 5%, then 25%, then 100% of traffic, pausing
+// and checking health between each step. This surfaces problems while exposing as few users
+// to them as possible, at the cost of a single large jump from 25% to 100% at the end. It
+// takes as many steps, and so as long, as LinearSteps.
+type ExponentialRamp struct {
+	Pause time.Duration
+}
+
+// Name implements Strategy.
+func (ExponentialRamp) Name() string { return "exponential" }
+
+// Run implements Strategy.
+func (s ExponentialRamp) Run(ctx context.Context, bp *backplane.Client, endpoint, oldRouteID, newRouteID string, health HealthCheck, record StepRecorder) error {
+	return runSteps(ctx, bp, endpoint, oldRouteID, newRouteID, s.Pause, []step{
+		{99, 1},
+		{95, 5},
+		{75, 25},
+		{0, 100},
+	}, health, nil, record)
+}
@@ -0,0 +1,27 @@
+package strategy
+
+import (
+	"context"
+	"time"
+
+	"github.com/Xe/dploy/lib/backplane"
+)
+
+// LinearSteps ramps traffic over to the new route in four even steps: 75/25, 50/50, 25/75,
+// then 0/100. This is dploy's original, default canary behavior.
+type LinearSteps struct {
+	Pause time.Duration
+}
+
+// Name implements Strategy.
+func (LinearSteps) Name() string { return "linear" }
+
+// Run implements Strategy.
+func (s LinearSteps) Run(ctx context.Context, bp *backplane.Client, endpoint, oldRouteID, newRouteID string, health HealthCheck, record StepRecorder) error {
+	return runSteps(ctx, bp, endpoint, oldRouteID, newRouteID, s.Pause, []step{
+		{75, 25},
+		{50, 50},
+		{25, 75},
+		{0, 100},
+	}, health, nil, record)
+}
@@ -0,0 +1,51 @@
+package strategy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Xe/dploy/lib/backplane"
+)
+
+// Manual ramps traffic through the same steps as LinearSteps, but waits on an approval hook
+// before advancing to each one. If Approve is nil, it prompts on stdin.
+type Manual struct {
+	Pause time.Duration
+
+	// Approve is consulted before every shaping step; a false return aborts the rollout.
+	// If nil, Run prompts on stdin instead.
+	Approve func() bool
+}
+
+// Name implements Strategy.
+func (Manual) Name() string { return "manual" }
+
+// Run implements Strategy.
+func (m Manual) Run(ctx context.Context, bp *backplane.Client, endpoint, oldRouteID, newRouteID string, health HealthCheck, record StepRecorder) error {
+	approve := m.Approve
+	if approve == nil {
+		approve = confirmStdin
+	}
+
+	return runSteps(ctx, bp, endpoint, oldRouteID, newRouteID, m.Pause, []step{
+		{75, 25},
+		{50, 50},
+		{25, 75},
+		{0, 100},
+	}, health, approve, record)
+}
+
+// confirmStdin is the default approval hook: it prompts the operator on stdin before every
+// shaping step.
+func confirmStdin() bool {
+	fmt.Print("Proceed with next shaping step? [y/N] ")
+
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	line = strings.TrimSpace(line)
+
+	return line == "y" || line == "Y"
+}
@@ -0,0 +1,112 @@
+// Package strategy implements traffic-shaping strategies for a dploy canary rollout. Each
+// Strategy drives Backplane through its own sequence of Shape calls between an old and new
+// route, consulting a HealthCheck between steps so a bad rollout can be aborted early.
+package strategy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Xe/dploy/lib/backplane"
+)
+
+// HealthCheck is consulted by a Strategy between shaping steps. It should inspect whatever
+// it needs (backend health, error rates, etc.) and return a non-nil error to abort the
+// rollout. A nil HealthCheck disables the check entirely.
+type HealthCheck func() error
+
+// StepRecorder is notified after every completed shaping step, with its 1-based position
+// among total steps, the weights it set, and when it started and finished. A nil
+// StepRecorder disables recording entirely.
+type StepRecorder func(step, total, oldWeight, newWeight int, started, finished time.Time)
+
+// Strategy describes how traffic should be ramped from an old route to a new one.
+type Strategy interface {
+	// Name identifies the strategy, e.g. for logging or --strategy flag matching.
+	Name() string
+
+	// Run shapes traffic from oldRouteID to newRouteID on endpoint, step by step, calling
+	// health between steps and record after each one. It returns the first error from Shape
+	// or health, if any, or ctx.Err() if ctx is canceled mid-rollout.
+	Run(ctx context.Context, bp *backplane.Client, endpoint, oldRouteID, newRouteID string, health HealthCheck, record StepRecorder) error
+}
+
+// Factory builds a Strategy configured with the pause duration to use between steps.
+type Factory func(pause time.Duration) Strategy
+
+var registry = map[string]Factory{}
+
+// Register adds a Strategy under name so it can later be selected with Get. Built-in
+// strategies register themselves from this package's init(); callers can register their own
+// the same way.
+func Register(name string, f Factory) {
+	registry[name] = f
+}
+
+// Get builds the Strategy registered under name, configured to pause between steps for the
+// given duration. ok is false if no Strategy was registered under that name.
+func Get(name string, pause time.Duration) (s Strategy, ok bool) {
+	f, ok := registry[name]
+	if !ok {
+		return nil, false
+	}
+
+	return f(pause), true
+}
+
+func init() {
+	Register("linear", func(pause time.Duration) Strategy { return LinearSteps{Pause: pause} })
+	Register("exponential", func(pause time.Duration) Strategy { return ExponentialRamp{Pause: pause} })
+	Register("bluegreen", func(pause time.Duration) Strategy { return BlueGreen{} })
+	Register("manual", func(pause time.Duration) Strategy { return Manual{Pause: pause} })
+}
+
+// step is one point in a weight ramp: old is the weight left on the old route, new is the
+// weight moved to the new route.
+type step struct {
+	old, new int
+}
+
+// runSteps shapes traffic through steps in order, pausing and checking health between each
+// one. If approve is non-nil it is consulted before every step and a false return aborts the
+// rollout without shaping further. If record is non-nil it is notified after every step. ctx
+// cancellation aborts the rollout, whether it's waiting out the pause or blocked on Shape.
+func runSteps(ctx context.Context, bp *backplane.Client, endpoint, oldRouteID, newRouteID string, pause time.Duration, steps []step, health HealthCheck, approve func() bool, record StepRecorder) error {
+	for i, s := range steps {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if approve != nil && !approve() {
+			return fmt.Errorf("strategy: rollout not approved at step %d/%d", i+1, len(steps))
+		}
+
+		started := time.Now()
+		if err := bp.Shape(ctx, endpoint, map[string]int{oldRouteID: s.old, newRouteID: s.new}); err != nil {
+			return err
+		}
+
+		if record != nil {
+			record(i+1, len(steps), s.old, s.new, started, time.Now())
+		}
+
+		if i == len(steps)-1 {
+			break
+		}
+
+		select {
+		case <-time.After(pause):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if health != nil {
+			if err := health(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
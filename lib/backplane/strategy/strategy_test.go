@@ -0,0 +1,129 @@
+package strategy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Xe/dploy/lib/backplane"
+)
+
+var errUnhealthy = errors.New("unhealthy")
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *backplane.Client {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	c, err := backplane.New("token", backplane.WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// TestLinearStepsRecordsEveryStep checks that LinearSteps shapes all four of its steps in
+// order and notifies record after each one with that step's weights.
+func TestLinearStepsRecordsEveryStep(t *testing.T) {
+	bp := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {})
+
+	var got []struct{ old, new int }
+	record := func(step, total, oldWeight, newWeight int, started, finished time.Time) {
+		got = append(got, struct{ old, new int }{oldWeight, newWeight})
+	}
+
+	s := LinearSteps{Pause: time.Millisecond}
+	if err := s.Run(context.Background(), bp, "ep", "old", "new", nil, record); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ old, new int }{{75, 25}, {50, 50}, {25, 75}, {0, 100}}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d recorded steps, got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("step %d: expected %+v, got %+v", i+1, want[i], got[i])
+		}
+	}
+}
+
+// TestLinearStepsAbortsOnUnhealthy checks that a HealthCheck error between steps stops the
+// ramp before any further Shape calls are made.
+func TestLinearStepsAbortsOnUnhealthy(t *testing.T) {
+	var shapes int
+	bp := newTestClient(t, func(w http.ResponseWriter, r *http.Request) { shapes++ })
+
+	health := func() error { return errUnhealthy }
+
+	s := LinearSteps{Pause: time.Millisecond}
+	err := s.Run(context.Background(), bp, "ep", "old", "new", health, nil)
+	if !errors.Is(err, errUnhealthy) {
+		t.Fatalf("expected errUnhealthy, got %v", err)
+	}
+
+	if shapes != 1 {
+		t.Fatalf("expected exactly 1 Shape call before aborting, got %d", shapes)
+	}
+}
+
+// TestManualStopsWhenNotApproved checks that Manual's approve hook gates every step, and that
+// a rejected approval stops the ramp without shaping that step.
+func TestManualStopsWhenNotApproved(t *testing.T) {
+	var shapes int
+	bp := newTestClient(t, func(w http.ResponseWriter, r *http.Request) { shapes++ })
+
+	calls := 0
+	m := Manual{
+		Pause: time.Millisecond,
+		Approve: func() bool {
+			calls++
+			return calls < 2
+		},
+	}
+
+	err := m.Run(context.Background(), bp, "ep", "old", "new", nil, nil)
+	if err == nil {
+		t.Fatal("expected an error when approval is rejected")
+	}
+
+	if shapes != 1 {
+		t.Fatalf("expected exactly 1 Shape call before rejection, got %d", shapes)
+	}
+}
+
+// TestBlueGreenSingleStep checks that BlueGreen flips traffic in one Shape call and records
+// it as step 1 of 1, without pausing or checking health between steps (there are none).
+func TestBlueGreenSingleStep(t *testing.T) {
+	var shapes int
+	bp := newTestClient(t, func(w http.ResponseWriter, r *http.Request) { shapes++ })
+
+	var gotStep, gotTotal int
+	record := func(step, total, oldWeight, newWeight int, started, finished time.Time) {
+		gotStep, gotTotal = step, total
+	}
+
+	if err := (BlueGreen{}).Run(context.Background(), bp, "ep", "old", "new", nil, record); err != nil {
+		t.Fatal(err)
+	}
+
+	if shapes != 1 {
+		t.Fatalf("expected exactly 1 Shape call, got %d", shapes)
+	}
+
+	if gotStep != 1 || gotTotal != 1 {
+		t.Fatalf("expected record(1, 1, ...), got record(%d, %d, ...)", gotStep, gotTotal)
+	}
+}
+
+// TestGetUnknownStrategy checks that Get reports ok=false for a name nothing registered.
+func TestGetUnknownStrategy(t *testing.T) {
+	if _, ok := Get("not-a-strategy", time.Second); ok {
+		t.Fatal("expected ok=false for an unregistered strategy name")
+	}
+}
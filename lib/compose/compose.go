@@ -0,0 +1,80 @@
+// Package compose loads a docker-compose/stack file and translates it into the per-service
+// metadata dploy needs to create Swarm services and Backplane routes for each one, the same
+// way `docker stack deploy` resolves a compose file into Swarm services.
+package compose
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/docker/cli/cli/compose/loader"
+	composetypes "github.com/docker/cli/cli/compose/types"
+)
+
+// Service is one service defined in a compose/stack file, translated into the shape dploy's
+// orchestration expects: an image to run, an endpoint to route traffic to, and the
+// Xe.dploy/* labels dploy already sets on services it creates directly.
+type Service struct {
+	Name         string
+	Image        string
+	Endpoint     string
+	Version      string
+	ReplicaCount uint64
+}
+
+// Load parses the compose/stack file at path and returns the services it defines. The order
+// of the returned services is not defined. A service's endpoint and version come from its `deploy.labels`
+// (Xe.dploy/endpoint, Xe.dploy/version); version defaults to "latest" and replica count
+// defaults to 1 if `deploy.replicas` isn't set, matching dploy's own CLI flag defaults.
+// Xe.dploy/endpoint is required: Load returns an error naming the service if it's missing,
+// rather than deploying it with no route to shape traffic onto.
+func Load(path string) ([]Service, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := loader.ParseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := loader.Load(composetypes.ConfigDetails{
+		ConfigFiles: []composetypes.ConfigFile{{Filename: path, Config: parsed}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]Service, 0, len(cfg.Services))
+	for _, s := range cfg.Services {
+		svc := Service{
+			Name:         s.Name,
+			Image:        s.Image,
+			Version:      "latest",
+			ReplicaCount: 1,
+		}
+
+		if s.Deploy.Labels != nil {
+			if v := s.Deploy.Labels["Xe.dploy/endpoint"]; v != "" {
+				svc.Endpoint = v
+			}
+
+			if v := s.Deploy.Labels["Xe.dploy/version"]; v != "" {
+				svc.Version = v
+			}
+		}
+
+		if svc.Endpoint == "" {
+			return nil, fmt.Errorf("service %s: missing Xe.dploy/endpoint label under deploy.labels", s.Name)
+		}
+
+		if s.Deploy.Replicas != nil {
+			svc.ReplicaCount = uint64(*s.Deploy.Replicas)
+		}
+
+		services = append(services, svc)
+	}
+
+	return services, nil
+}
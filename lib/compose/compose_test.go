@@ -0,0 +1,100 @@
+package compose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeCompose(t *testing.T, contents string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "docker-compose.yml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// TestLoadResolvesLabelsAndDefaults checks that Load picks up the Xe.dploy/endpoint and
+// Xe.dploy/version labels, and falls back to "latest"/1 replica when version/replicas aren't
+// set.
+func TestLoadResolvesLabelsAndDefaults(t *testing.T) {
+	path := writeCompose(t, `
+version: "3.7"
+services:
+  web:
+    image: example/web
+    deploy:
+      labels:
+        Xe.dploy/endpoint: web.example.com
+        Xe.dploy/version: v2
+      replicas: 3
+  worker:
+    image: example/worker
+    deploy:
+      labels:
+        Xe.dploy/endpoint: worker.example.com
+`)
+
+	services, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(services) != 2 {
+		t.Fatalf("expected 2 services, got %d: %+v", len(services), services)
+	}
+
+	byName := map[string]Service{}
+	for _, s := range services {
+		byName[s.Name] = s
+	}
+
+	web, ok := byName["web"]
+	if !ok {
+		t.Fatalf("expected a web service, got %+v", services)
+	}
+	if web.Endpoint != "web.example.com" || web.Version != "v2" || web.ReplicaCount != 3 {
+		t.Fatalf("unexpected web service: %+v", web)
+	}
+
+	worker, ok := byName["worker"]
+	if !ok {
+		t.Fatalf("expected a worker service, got %+v", services)
+	}
+	if worker.Endpoint != "worker.example.com" || worker.Version != "latest" || worker.ReplicaCount != 1 {
+		t.Fatalf("unexpected worker service, want default version/replicas: %+v", worker)
+	}
+}
+
+// TestLoadRequiresEndpointLabel checks that Load rejects a service with no
+// Xe.dploy/endpoint label instead of deploying it with nowhere to shape traffic.
+func TestLoadRequiresEndpointLabel(t *testing.T) {
+	path := writeCompose(t, `
+version: "3.7"
+services:
+  web:
+    image: example/web
+`)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected an error for a service missing Xe.dploy/endpoint")
+	}
+}
+
+// TestLoadMissingFile checks that Load surfaces the underlying error for a path that doesn't
+// exist, rather than panicking or returning a zero-value result silently.
+func TestLoadMissingFile(t *testing.T) {
+	_, err := Load(filepath.Join(t.TempDir(), "does-not-exist.yml"))
+	if err == nil {
+		t.Fatal("expected an error for a missing compose file")
+	}
+	if !os.IsNotExist(err) {
+		t.Fatalf("expected a not-exist error, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package script
+
+import (
+	"github.com/Xe/dploy/lib/backplane"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// registerBackplane exposes backplane.Client as a `bp` Lua module with query, route, shape,
+// and gentoken functions, mirroring the Go methods of the same name.
+func (p *Pipeline) registerBackplane() {
+	mod := p.L.NewTable()
+
+	p.L.SetField(mod, "query", p.L.NewFunction(p.luaQuery))
+	p.L.SetField(mod, "route", p.L.NewFunction(p.luaRoute))
+	p.L.SetField(mod, "shape", p.L.NewFunction(p.luaShape))
+	p.L.SetField(mod, "gentoken", p.L.NewFunction(p.luaGenToken))
+
+	p.L.SetGlobal("bp", mod)
+}
+
+// luaQuery implements bp.query() -> table, err.
+func (p *Pipeline) luaQuery(L *lua.LState) int {
+	q, err := p.bp.Query(p.ctx)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	L.Push(queryToTable(L, q))
+	return 1
+}
+
+// luaRoute implements bp.route(pattern, labels) -> table, err.
+func (p *Pipeline) luaRoute(L *lua.LState) int {
+	pattern := L.CheckString(1)
+	labels := tableToStrings(L.CheckTable(2))
+
+	route, err := p.bp.Route(p.ctx, pattern, labels)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	t := L.NewTable()
+	L.SetField(t, "ID", lua.LString(route.ID))
+	L.SetField(t, "Weight", lua.LNumber(route.Weight))
+	L.Push(t)
+	return 1
+}
+
+// luaShape implements bp.shape(endpoint, {[routeID]=weight, ...}) -> err.
+func (p *Pipeline) luaShape(L *lua.LState) int {
+	endpoint := L.CheckString(1)
+	weightsTable := L.CheckTable(2)
+
+	weights := map[string]int{}
+	weightsTable.ForEach(func(k, v lua.LValue) {
+		weights[k.String()] = int(lua.LVAsNumber(v))
+	})
+
+	if err := p.bp.Shape(p.ctx, endpoint, weights); err != nil {
+		L.Push(lua.LString(err.Error()))
+		return 1
+	}
+
+	L.Push(lua.LNil)
+	return 1
+}
+
+// luaGenToken implements bp.gentoken() -> token, err.
+func (p *Pipeline) luaGenToken(L *lua.LState) int {
+	token, err := p.bp.GenToken(p.ctx)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	L.Push(lua.LString(token))
+	return 1
+}
+
+// queryToTable converts a QueryResponse into the nested Lua table a script sees from
+// bp.query(), e.g. bp.query().Endpoints[1].Routes[1].Backends.
+func queryToTable(L *lua.LState, q *backplane.QueryResponse) *lua.LTable {
+	root := L.NewTable()
+	L.SetField(root, "Token", lua.LString(q.Token))
+
+	endpoints := L.NewTable()
+	for _, e := range q.Endpoints {
+		et := L.NewTable()
+		L.SetField(et, "Pattern", lua.LString(e.Pattern))
+		L.SetField(et, "Owner", lua.LString(e.Owner))
+
+		routes := L.NewTable()
+		for _, r := range e.Routes {
+			rt := L.NewTable()
+			L.SetField(rt, "ID", lua.LString(r.ID))
+			L.SetField(rt, "Weight", lua.LNumber(r.Weight))
+			L.SetField(rt, "Strategy", lua.LString(r.Strategy))
+
+			backends := L.NewTable()
+			for _, b := range r.Backends {
+				backends.Append(lua.LString(b))
+			}
+			L.SetField(rt, "Backends", backends)
+
+			routes.Append(rt)
+		}
+		L.SetField(et, "Routes", routes)
+
+		endpoints.Append(et)
+	}
+	L.SetField(root, "Endpoints", endpoints)
+
+	backends := L.NewTable()
+	for _, b := range q.Backends {
+		bt := L.NewTable()
+		L.SetField(bt, "ID", lua.LString(b.ID))
+		L.SetField(bt, "State", lua.LString(b.State))
+		L.SetField(bt, "RequestsPerSecond", lua.LNumber(b.RequestsPerSecond))
+		backends.Append(bt)
+	}
+	L.SetField(root, "Backends", backends)
+
+	return root
+}
+
+// tableToStrings flattens a Lua string-keyed table into a map[string]string, the shape
+// backplane.Client.Route expects for labels.
+func tableToStrings(t *lua.LTable) map[string]string {
+	out := map[string]string{}
+	t.ForEach(func(k, v lua.LValue) {
+		out[k.String()] = v.String()
+	})
+
+	return out
+}
@@ -0,0 +1,43 @@
+package script
+
+import "fmt"
+
+// This file embeds lib/script/stdlib so it ships inside the dploy binary. It would normally
+// be produced by go-bindata; it's hand-maintained here in the same shape go-bindata would
+// generate so regenerating it later is a drop-in swap.
+//
+//go:generate go-bindata -pkg script -o bindata.go stdlib/...
+
+var _bindata = map[string]string{
+	"stdlib/helpers.lua": `-- retry calls fn up to attempts times (default 3), sleeping wait seconds (default 1) between
+-- tries, and returns as soon as fn's first return value is truthy. If every attempt fails it
+-- returns false plus an explanatory message.
+function retry(fn, attempts, wait)
+  attempts = attempts or 3
+  wait = wait or 1
+
+  for i = 1, attempts do
+    local ok, err = fn()
+    if ok then
+      return ok, err
+    end
+
+    if i < attempts then
+      sleep(wait)
+    end
+  end
+
+  return false, "retry: exhausted all attempts"
+end
+`,
+}
+
+// Asset returns the embedded contents of a stdlib file by name, e.g. "stdlib/helpers.lua".
+func Asset(name string) ([]byte, error) {
+	data, ok := _bindata[name]
+	if !ok {
+		return nil, fmt.Errorf("script: no such asset %q", name)
+	}
+
+	return []byte(data), nil
+}
@@ -0,0 +1,44 @@
+package script
+
+import (
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// registerDocker exposes a `docker` Lua module with a createservice helper, for scripts that
+// want to create a Swarm service themselves instead of relying on dploy's built-in flags.
+func (p *Pipeline) registerDocker() {
+	mod := p.L.NewTable()
+
+	p.L.SetField(mod, "createservice", p.L.NewFunction(p.luaCreateService))
+
+	p.L.SetGlobal("docker", mod)
+}
+
+// luaCreateService implements docker.createservice(name, image, replicas) -> serviceID, err.
+func (p *Pipeline) luaCreateService(L *lua.LState) int {
+	name := L.CheckString(1)
+	image := L.CheckString(2)
+	replicas := uint64(L.CheckNumber(3))
+
+	svc := swarm.ServiceSpec{
+		Annotations: swarm.Annotations{Name: name},
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: swarm.ContainerSpec{Image: image},
+		},
+		Mode: swarm.ServiceMode{
+			Replicated: &swarm.ReplicatedService{Replicas: &replicas},
+		},
+	}
+
+	resp, err := p.cli.ServiceCreate(p.ctx, svc, types.ServiceCreateOptions{})
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	L.Push(lua.LString(resp.ID))
+	return 1
+}
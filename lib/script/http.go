@@ -0,0 +1,45 @@
+package script
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// registerHTTP exposes a minimal `http` Lua module so a script can run a smoke test against
+// the service it just deployed before advancing the shape schedule.
+func (p *Pipeline) registerHTTP() {
+	mod := p.L.NewTable()
+
+	p.L.SetField(mod, "get", p.L.NewFunction(p.luaHTTPGet))
+
+	p.L.SetGlobal("http", mod)
+}
+
+// luaHTTPGet implements http.get(url) -> {status=, body=}, err.
+func (p *Pipeline) luaHTTPGet(L *lua.LState) int {
+	url := L.CheckString(1)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	t := L.NewTable()
+	L.SetField(t, "status", lua.LNumber(resp.StatusCode))
+	L.SetField(t, "body", lua.LString(string(body)))
+
+	L.Push(t)
+	return 1
+}
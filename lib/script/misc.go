@@ -0,0 +1,28 @@
+package script
+
+import (
+	"log"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// registerMisc exposes a couple of free functions scripts and the embedded stdlib lean on:
+// sleep, for pausing between shape steps, and log, for matching dploy's own log output.
+func (p *Pipeline) registerMisc() {
+	p.L.SetGlobal("sleep", p.L.NewFunction(p.luaSleep))
+	p.L.SetGlobal("log", p.L.NewFunction(p.luaLog))
+}
+
+// luaSleep implements sleep(seconds).
+func (p *Pipeline) luaSleep(L *lua.LState) int {
+	secs := float64(L.CheckNumber(1))
+	time.Sleep(time.Duration(secs * float64(time.Second)))
+	return 0
+}
+
+// luaLog implements log(message).
+func (p *Pipeline) luaLog(L *lua.LState) int {
+	log.Println(L.CheckString(1))
+	return 0
+}
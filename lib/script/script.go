@@ -0,0 +1,83 @@
+// Package script lets a deploy be driven by a user-authored deploy.lua file instead of (or
+// in addition to) dploy's CLI flags. It exposes backplane.Client, a small Docker service
+// helper, and a couple of utility modules to Lua, plus an embedded stdlib of common helpers,
+// analogous to an eclier-style command loader.
+package script
+
+import (
+	"context"
+
+	"github.com/Xe/dploy/lib/backplane"
+	"github.com/docker/docker/client"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Pipeline is a loaded deploy.lua script, wired up to a live Backplane client and Docker
+// client so it can drive a real deploy.
+type Pipeline struct {
+	L   *lua.LState
+	ctx context.Context
+	bp  *backplane.Client
+	cli *client.Client
+}
+
+// New loads the embedded stdlib followed by the deploy script at path, registering the bp,
+// docker, and http modules the script can call into. ctx is used for every Backplane call
+// the script makes, so canceling it (e.g. from a signal handler) cancels the script's calls
+// too.
+func New(ctx context.Context, path string, bp *backplane.Client, cli *client.Client) (*Pipeline, error) {
+	p := &Pipeline{
+		L:   lua.NewState(),
+		ctx: ctx,
+		bp:  bp,
+		cli: cli,
+	}
+
+	p.registerBackplane()
+	p.registerDocker()
+	p.registerHTTP()
+	p.registerMisc()
+
+	stdlib, err := Asset("stdlib/helpers.lua")
+	if err != nil {
+		p.L.Close()
+		return nil, err
+	}
+
+	if err := p.L.DoString(string(stdlib)); err != nil {
+		p.L.Close()
+		return nil, err
+	}
+
+	if err := p.L.DoFile(path); err != nil {
+		p.L.Close()
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Close releases the underlying Lua state.
+func (p *Pipeline) Close() {
+	p.L.Close()
+}
+
+// HasHook reports whether the script defines a global function named name.
+func (p *Pipeline) HasHook(name string) bool {
+	return p.L.GetGlobal(name) != lua.LNil
+}
+
+// Call invokes the script's global function name with args, if it defines one. Scripts that
+// don't define the hook are silently skipped.
+func (p *Pipeline) Call(name string, args ...lua.LValue) error {
+	fn := p.L.GetGlobal(name)
+	if fn == lua.LNil {
+		return nil
+	}
+
+	return p.L.CallByParam(lua.P{
+		Fn:      fn,
+		NRet:    0,
+		Protect: true,
+	}, args...)
+}
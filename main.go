@@ -6,12 +6,18 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"sync"
 	"time"
 
+	"github.com/Xe/dploy/internal/database"
 	"github.com/Xe/dploy/lib/backplane"
+	"github.com/Xe/dploy/lib/backplane/strategy"
+	"github.com/Xe/dploy/lib/script"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/client"
+	lua "github.com/yuin/gopher-lua"
 )
 
 var (
@@ -24,11 +30,120 @@ var (
 	routeID           = flag.String("route", "", "existing route ID to shape to if it exists already")
 	shapePause        = flag.Duration("shape-pause", 30*time.Second, "how long to wait between each step of backend shaping")
 	dontCreateService = flag.Bool("dont-create-service", false, "don't create the service")
+	errorThreshold    = flag.Float64("error-threshold", 0.5, "fraction of unhealthy backends on the new route that triggers an automatic rollback")
+	strategyName      = flag.String("strategy", "linear", "traffic-shaping strategy to use (linear, exponential, bluegreen, manual)")
+	deployScript      = flag.String("deploy-script", "", "path to a deploy.lua pipeline script to drive this deploy (optional)")
+	composeFile       = flag.String("compose-file", "", "path to a docker-compose/stack file describing multiple services to deploy together (optional)")
+	dbDriver          = flag.String("db-driver", "", "database driver to record deploy history with (postgres, sqlite3); history is disabled if unset")
+	dbDSN             = flag.String("db-dsn", "dploy.db", "database DSN to record deploy history with")
 )
 
+// subcommands dispatches dploy's history/rollback/status subcommands, which manage
+// already-recorded deploy history rather than performing a deploy themselves. If os.Args
+// doesn't name one of them, ok is false and the caller should fall through to a normal
+// deploy.
+func subcommands(args []string) (ok bool) {
+	if len(args) == 0 {
+		return false
+	}
+
+	switch args[0] {
+	case "history":
+		runHistory(args[1:])
+	case "rollback":
+		runRollback(args[1:])
+	case "status":
+		runStatus(args[1:])
+	default:
+		return false
+	}
+
+	return true
+}
+
+// rollbackState tracks what main has created so far so that a rollback triggered mid-deploy
+// (either by a failed health check or by ^C) knows what to undo. It is populated as the
+// deploy progresses and read by rollback.
+var rollbackState struct {
+	serviceID string
+	oldRoute  string
+	newRoute  string
+}
+
+// deployRecord tracks the deploy history Store and the ID of the in-progress deploy, if
+// history recording is enabled via --db-driver. Both rollback (on ^C) and main's own
+// bookkeeping need to mark the deploy's final outcome.
+var deployRecord struct {
+	store database.Store
+	id    int64
+}
+
+// rollbackOnce guards against rollback/composeRollback running twice, since a ^C can race
+// the main goroutine's own error path: both observe a failure (one from the canceled
+// deployCtx, one from the signal itself) and would otherwise call Shape/ServiceRemove twice
+// and race two different FinishDeploy outcomes against each other. Every call site runs its
+// rollback through rollbackOnce.Do, so whichever caller gets there first does the work and
+// the other blocks until it's done instead of exiting independently mid-cleanup.
+var rollbackOnce sync.Once
+
+// rollback re-shapes traffic back onto the old route at 100% and tears down the Swarm
+// service that was created for this deploy, if one was. It is safe to call with any subset
+// of rollbackState populated, since createService/createRoute/shape may not have run yet.
+// outcome is recorded against the deploy history, if enabled (database.OutcomeRollback or
+// database.OutcomeAborted). rollback uses context.Background() rather than the deploy's own
+// context, since it's the thing that runs after that context has been canceled.
+func rollback(bp *backplane.Client, cli *client.Client, outcome string) {
+	if rollbackState.oldRoute != "" && rollbackState.newRoute != "" {
+		log.Println("Rolling back: reshaping traffic back to " + rollbackState.oldRoute)
+		if err := shape(context.Background(), bp, rollbackState.oldRoute, rollbackState.newRoute, 100, 0); err != nil {
+			log.Println("rollback: failed to reshape traffic: " + err.Error())
+		}
+	}
+
+	if rollbackState.serviceID != "" {
+		log.Println("Rolling back: removing service " + rollbackState.serviceID)
+		if err := cli.ServiceRemove(context.Background(), rollbackState.serviceID); err != nil {
+			log.Println("rollback: failed to remove service: " + err.Error())
+		}
+	}
+
+	if deployRecord.store != nil && deployRecord.id != 0 {
+		if err := deployRecord.store.FinishDeploy(deployRecord.id, outcome, time.Now()); err != nil {
+			log.Println("rollback: failed to record deploy outcome: " + err.Error())
+		}
+	}
+}
+
+// checkHealth polls Backplane for the health of the new route's backends and returns an
+// error describing the problem if the fraction of unhealthy backends exceeds errorThreshold.
+func checkHealth(ctx context.Context, bp *backplane.Client) error {
+	total, unhealthy, err := bp.RouteHealth(ctx, *endpoint, rollbackState.newRoute)
+	if err != nil {
+		return err
+	}
+
+	if total == 0 {
+		return nil
+	}
+
+	if float64(unhealthy)/float64(total) > *errorThreshold {
+		return fmt.Errorf("%d/%d backends on new route unhealthy", unhealthy, total)
+	}
+
+	return nil
+}
+
 func main() {
+	if subcommands(os.Args[1:]) {
+		return
+	}
+
 	flag.Parse()
 
+	if *composeFile != "" && *dbDriver != "" {
+		log.Fatal("--compose-file doesn't support --db-driver yet: coordinated multi-service deploys aren't recorded to deploy history")
+	}
+
 	if *backplaneToken == "" {
 		*backplaneToken = os.Getenv("BACKPLANE_TOKEN")
 	}
@@ -37,7 +152,6 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	_ = bp
 
 	defaultHeaders := map[string]string{"User-Agent": "dploy-devel"}
 	cli, err := client.NewClient(client.DefaultDockerHost, client.DefaultVersion, nil, defaultHeaders)
@@ -45,36 +159,89 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if *dbDriver != "" {
+		store, err := database.Open(*dbDriver, *dbDSN)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer store.Close()
+
+		deployRecord.store = store
+	}
+
+	deployCtx, cancelDeploy := context.WithCancel(context.Background())
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	go func() {
+		<-sigCh
+		log.Println("Caught interrupt, rolling back changes")
+		cancelDeploy()
+		rollbackOnce.Do(func() {
+			if *composeFile != "" {
+				composeRollback(cli, bp)
+			} else {
+				rollback(bp, cli, database.OutcomeAborted)
+			}
+		})
+		os.Exit(1)
+	}()
+
+	if *composeFile != "" {
+		if err := runComposeDeploy(deployCtx, cli, bp, *composeFile); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var pipeline *script.Pipeline
+	if *deployScript != "" {
+		pipeline, err = script.New(deployCtx, *deployScript, bp, cli)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer pipeline.Close()
+
+		if err := pipeline.Call("predeploy"); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	if !*dontCreateService {
-		id, err := createService(cli, bp)
+		id, err := createService(deployCtx, cli, bp)
 		if err != nil {
 			log.Fatal(err)
 		}
 
+		rollbackState.serviceID = id
 		log.Println("Created service " + id)
 	} else {
 		log.Println("Skipping service creation")
 	}
 
 	if *routeID == "" {
-		*routeID, err = createRoute(cli, bp)
+		*routeID, err = createRoute(deployCtx, cli, bp)
 		if err != nil {
 			log.Fatal(err)
 		}
 	} else {
 		log.Println("Skipping route creation, using " + *routeID)
 	}
+	rollbackState.newRoute = *routeID
 
 	log.Println("Waiting for services to be primed...")
 
-	waitForContainers(bp)
+	waitForContainers(deployCtx, bp)
+	if deployCtx.Err() != nil {
+		rollbackOnce.Do(func() { rollback(bp, cli, database.OutcomeAborted) })
+		log.Fatal("deploy aborted, rolled back")
+	}
 
 	log.Printf("Service %s at version %s is now all ready for traffic", *serviceName, *versionID)
 
-	log.Println("Performing 0 downtime shape (3 steps)")
-	log.Println("In case of emergency, press ^C") // TODO(Xe): Implement this, have it roll back changes
+	log.Println("In case of emergency, press ^C")
 
-	q, err := bp.Query()
+	q, err := bp.Query(deployCtx)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -95,40 +262,76 @@ func main() {
 			break
 		}
 	}
-
-	log.Println("Shaping 1/3 (75 old / 25 new)")
-
-	err = shape(bp, oldRoute.ID, *routeID, 75, 25)
-	if err != nil {
-		log.Fatal(err)
+	rollbackState.oldRoute = oldRoute.ID
+
+	if deployRecord.store != nil {
+		deployRecord.id, err = deployRecord.store.CreateDeploy(database.Deploy{
+			Service:    *serviceName,
+			Image:      *appImage,
+			Version:    *versionID,
+			Endpoint:   *endpoint,
+			OldRouteID: oldRoute.ID,
+			NewRouteID: *routeID,
+			StartedAt:  time.Now(),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	time.Sleep(*shapePause)
+	var record strategy.StepRecorder
+	if deployRecord.store != nil {
+		record = func(step, total, oldWeight, newWeight int, started, finished time.Time) {
+			err := deployRecord.store.RecordStep(database.ShapeStep{
+				DeployID:   deployRecord.id,
+				Step:       step,
+				OldWeight:  oldWeight,
+				NewWeight:  newWeight,
+				StartedAt:  started,
+				FinishedAt: finished,
+			})
+			if err != nil {
+				log.Println("failed to record shape step: " + err.Error())
+			}
+		}
+	}
 
-	log.Println("Shaping 2/3 (50 old / 50 new)")
+	if pipeline != nil && pipeline.HasHook("deploy") {
+		log.Println("Performing 0 downtime shape using deploy.lua's deploy() hook")
+		log.Println("warning: deploy.lua's deploy() hook drives its own shaping, so the --error-threshold auto-rollback and shape-step history are not active for this deploy")
 
-	err = shape(bp, oldRoute.ID, *routeID, 50, 50)
-	if err != nil {
-		log.Fatal(err)
-	}
+		err = pipeline.Call("deploy", lua.LString(oldRoute.ID), lua.LString(*routeID), lua.LString(*endpoint))
+	} else {
+		strat, ok := strategy.Get(*strategyName, *shapePause)
+		if !ok {
+			log.Fatalf("unknown strategy %q", *strategyName)
+		}
 
-	time.Sleep(*shapePause)
+		log.Printf("Performing 0 downtime shape using the %s strategy", strat.Name())
 
-	log.Println("Shaping 3/3 (25 old / 75 new)")
+		err = strat.Run(deployCtx, bp, *endpoint, oldRoute.ID, *routeID, func() error { return checkHealth(deployCtx, bp) }, record)
+	}
 
-	err = shape(bp, oldRoute.ID, *routeID, 25, 75)
 	if err != nil {
-		log.Fatal(err)
+		log.Println("Shaping failed: " + err.Error())
+		rollbackOnce.Do(func() { rollback(bp, cli, database.OutcomeRollback) })
+		log.Fatal("deploy aborted, rolled back")
 	}
 
-	time.Sleep(*shapePause)
+	log.Println("100% of traffic has been shaped over to " + *routeID)
 
-	err = shape(bp, oldRoute.ID, *routeID, 0, 100)
-	if err != nil {
-		log.Fatal(err)
+	if pipeline != nil {
+		if err := pipeline.Call("postdeploy"); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if deployRecord.store != nil {
+		if err := deployRecord.store.FinishDeploy(deployRecord.id, database.OutcomeSuccess, time.Now()); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	log.Println("100% of traffic has been shaped over to " + *routeID)
 	log.Println("Deploy complete")
 }
 
@@ -146,8 +349,8 @@ func main() {
 	req.SetBasicAauth(n.Machine(backplaneHost).Get("login"), "")
 */
 
-func createService(c *client.Client, bp *backplane.Client) (string, error) {
-	token, err := bp.GenToken()
+func createService(ctx context.Context, c *client.Client, bp *backplane.Client) (string, error) {
+	token, err := bp.GenToken(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -182,7 +385,7 @@ func createService(c *client.Client, bp *backplane.Client) (string, error) {
 		},
 	}
 
-	resp, err := c.ServiceCreate(context.Background(), svc, types.ServiceCreateOptions{})
+	resp, err := c.ServiceCreate(ctx, svc, types.ServiceCreateOptions{})
 	if err != nil {
 		return "", err
 	}
@@ -190,8 +393,8 @@ func createService(c *client.Client, bp *backplane.Client) (string, error) {
 	return resp.ID, nil
 }
 
-func createRoute(c *client.Client, bp *backplane.Client) (string, error) {
-	route, err := bp.Route(*endpoint, map[string]string{
+func createRoute(ctx context.Context, c *client.Client, bp *backplane.Client) (string, error) {
+	route, err := bp.Route(ctx, *endpoint, map[string]string{
 		"service":  *serviceName,
 		"endpoint": *endpoint,
 		"version":  *versionID,
@@ -204,8 +407,8 @@ func createRoute(c *client.Client, bp *backplane.Client) (string, error) {
 	return route.ID, nil
 }
 
-func shape(bp *backplane.Client, oldroute, newroute string, oldweight, newweight int) error {
-	err := bp.Shape(*endpoint, map[string]int{
+func shape(ctx context.Context, bp *backplane.Client, oldroute, newroute string, oldweight, newweight int) error {
+	err := bp.Shape(ctx, *endpoint, map[string]int{
 		oldroute: oldweight,
 		newroute: newweight,
 	})
@@ -216,14 +419,23 @@ func shape(bp *backplane.Client, oldroute, newroute string, oldweight, newweight
 	return nil
 }
 
-func waitForContainers(bp *backplane.Client) {
+// waitForContainers polls Backplane until the new route has as many backends as
+// replicaCount, or ctx is canceled (e.g. by the ^C handler), in which case it returns early.
+func waitForContainers(ctx context.Context, bp *backplane.Client) {
 	t := time.Tick(time.Second)
 
 outer:
 	for {
-		<-t
+		select {
+		case <-ctx.Done():
+			return
+		case <-t:
+		}
 
-		q, err := bp.Query()
+		q, err := bp.Query(ctx)
+		if err != nil && ctx.Err() != nil {
+			return
+		}
 		if err != nil {
 			log.Fatal(err)
 		}
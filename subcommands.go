@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Xe/dploy/internal/database"
+	"github.com/Xe/dploy/lib/backplane"
+)
+
+// dbFlags registers the --db-driver/--db-dsn flags shared by the history, rollback, and
+// status subcommands, and returns a func that opens the Store they describe.
+func dbFlags(fs *flag.FlagSet) func() database.Store {
+	driver := fs.String("db-driver", "sqlite3", "database driver the deploy history is stored with (postgres, sqlite3)")
+	dsn := fs.String("db-dsn", "dploy.db", "database DSN the deploy history is stored with")
+
+	return func() database.Store {
+		store, err := database.Open(*driver, *dsn)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return store
+	}
+}
+
+// runHistory implements `dploy history`: it lists every recorded deploy, most recent first.
+func runHistory(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	openStore := dbFlags(fs)
+	fs.Parse(args)
+
+	store := openStore()
+	defer store.Close()
+
+	deploys, err := store.Deploys()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSERVICE\tVERSION\tENDPOINT\tOUTCOME\tSTARTED\tFINISHED")
+
+	for _, d := range deploys {
+		outcome := d.Outcome
+		if outcome == "" {
+			outcome = "in-progress"
+		}
+
+		finished := "-"
+		if d.FinishedAt != nil {
+			finished = d.FinishedAt.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", d.ID, d.Service, d.Version, d.Endpoint, outcome, d.StartedAt.Format(time.RFC3339), finished)
+	}
+
+	w.Flush()
+}
+
+// runStatus implements `dploy status`: it reports any deploys that are still in progress.
+func runStatus(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	openStore := dbFlags(fs)
+	fs.Parse(args)
+
+	store := openStore()
+	defer store.Close()
+
+	deploys, err := store.Deploys()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	inProgress := 0
+	for _, d := range deploys {
+		if d.Outcome != "" {
+			continue
+		}
+
+		inProgress++
+		log.Printf("Deploy %d: %s %s on %s is in progress (started %s)", d.ID, d.Service, d.Version, d.Endpoint, d.StartedAt.Format(time.RFC3339))
+	}
+
+	if inProgress == 0 {
+		log.Println("No deploys in progress")
+	}
+}
+
+// runRollback implements `dploy rollback <deploy-id>`: it reshapes traffic back onto the
+// deploy's recorded old route at 100% without re-querying Backplane state, which may have
+// changed since the deploy ran. It refuses to do so for a deploy that already has an outcome
+// recorded (success, rollback, or aborted) unless --force is passed, since reshaping one of
+// those would clobber whatever route weights are current for an unrelated reason.
+func runRollback(args []string) {
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	openStore := dbFlags(fs)
+	backplaneToken := fs.String("backplane-token", "", "backplane token, or BACKPLANE_TOKEN from env")
+	force := fs.Bool("force", false, "reshape traffic even if the deploy has already finished (success, rollback, or aborted)")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		log.Fatal("usage: dploy rollback [flags] <deploy-id>")
+	}
+
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		log.Fatalf("invalid deploy id %q: %v", fs.Arg(0), err)
+	}
+
+	store := openStore()
+	defer store.Close()
+
+	d, _, err := store.Deploy(id)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if d.Outcome != "" && !*force {
+		log.Fatalf("deploy %d already finished with outcome %q; pass --force to reshape traffic anyway", d.ID, d.Outcome)
+	}
+
+	token := *backplaneToken
+	if token == "" {
+		token = os.Getenv("BACKPLANE_TOKEN")
+	}
+
+	bp, err := backplane.New(token)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Rolling back deploy %d (%s %s): reshaping %s back to 100%% on %s", d.ID, d.Service, d.Version, d.OldRouteID, d.Endpoint)
+
+	if err := bp.Shape(context.Background(), d.Endpoint, map[string]int{d.OldRouteID: 100, d.NewRouteID: 0}); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := store.FinishDeploy(d.ID, database.OutcomeRollback, time.Now()); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println("Rollback complete")
+}